@@ -115,6 +115,24 @@ func (c *Cache) Put(playlistId string, items ...*feeds.Item) {
 	}
 }
 
+// topUpFromCache fills items up to limit with older cached entries for key,
+// picking up right after the last item already present. Backends that don't
+// paginate lazily (like ScraperService) can use this to share the same
+// cache-backed pagination as YoutubeAPIService.
+func topUpFromCache(cache *Cache, key string, items []*feeds.Item, limit int) ([]*feeds.Item, error) {
+	if len(items) == 0 {
+		return items, nil
+	}
+	after := items[len(items)-1].Created.Format(time.RFC3339)
+	for item, err := range take(max(0, limit-len(items)), cache.Iter(key, after)) {
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
 func (c *Cache) Iter(playlistId string, after string) iter.Seq2[*feeds.Item, error] {
 	return func(yield func(*feeds.Item, error) bool) {
 		err := c.View(func(tx *bbolt.Tx) error {
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+type DownloadState string
+
+const (
+	StateQueued      DownloadState = "queued"
+	StateDownloading DownloadState = "downloading"
+	StateDone        DownloadState = "done"
+	StateFailed      DownloadState = "failed"
+)
+
+var downloadsBucket = []byte("downloads")
+
+type downloadRecord struct {
+	VideoId   string        `json:"videoId"`
+	State     DownloadState `json:"state"`
+	Path      string        `json:"path,omitempty"`
+	Size      int64         `json:"size,omitempty"`
+	Attempts  int           `json:"attempts"`
+	UpdatedAt time.Time     `json:"updatedAt"`
+	NextRetry time.Time     `json:"nextRetry,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	Meta      AudioMeta     `json:"meta,omitempty"`
+}
+
+// Downloader maintains an on-disk store of downloaded videos, so yt2rss can
+// serve media directly via http.ServeFile instead of redirecting to a
+// yt-dlp-resolved url on every request.
+type Downloader struct {
+	MediaDir      string
+	YtdlCommand   string
+	MaxConcurrent int
+	MaxAge        time.Duration
+	MaxBytes      int64
+	DB            *bbolt.DB
+
+	// Audio, when set, makes the downloader transcode every raw download
+	// into an audio-only file via ffmpeg instead of keeping the video.
+	Audio         bool
+	AudioFormat   string // "mp3" or "opus"
+	AudioBitrate  string
+	FfmpegCommand string
+
+	sem chan struct{}
+}
+
+func NewDownloader(db *bbolt.DB, mediaDir, ytdlCommand string, maxConcurrent int, maxAge time.Duration, maxBytes int64) *Downloader {
+	return &Downloader{
+		MediaDir:      mediaDir,
+		YtdlCommand:   ytdlCommand,
+		MaxConcurrent: maxConcurrent,
+		MaxAge:        maxAge,
+		MaxBytes:      maxBytes,
+		DB:            db,
+		sem:           make(chan struct{}, maxConcurrent),
+	}
+}
+
+// Enqueue records videoId as wanted, unless it is already known, so the next
+// Run tick picks it up for download. meta is only used when Audio is
+// enabled, to tag the transcoded file.
+func (d *Downloader) Enqueue(videoId string, meta AudioMeta) error {
+	return d.DB.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(downloadsBucket)
+		if err != nil {
+			return err
+		}
+		if b.Get([]byte(videoId)) != nil {
+			return nil
+		}
+		record := downloadRecord{VideoId: videoId, State: StateQueued, UpdatedAt: time.Now(), Meta: meta}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(videoId), data)
+	})
+}
+
+// Lookup returns the on-disk path and size of a finished download, or false
+// if it is not (yet) available.
+func (d *Downloader) Lookup(videoId string) (path string, size int64, ok bool) {
+	record, found := d.get(videoId)
+	if !found || record.State != StateDone {
+		return "", 0, false
+	}
+	info, err := os.Stat(record.Path)
+	if err != nil {
+		return "", 0, false
+	}
+	return record.Path, info.Size(), true
+}
+
+func (d *Downloader) get(videoId string) (downloadRecord, bool) {
+	var record downloadRecord
+	var found bool
+	_ = d.DB.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(downloadsBucket)
+		if b == nil {
+			return nil
+		}
+		data := b.Get([]byte(videoId))
+		if data == nil {
+			return nil
+		}
+		found = json.Unmarshal(data, &record) == nil
+		return nil
+	})
+	return record, found
+}
+
+func (d *Downloader) put(record downloadRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return d.DB.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(downloadsBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(record.VideoId), data)
+	})
+}
+
+// Run picks up queued (and due-for-retry) downloads and garbage collects old
+// files on every tick of interval, until ctx is cancelled.
+func (d *Downloader) Run(ctx context.Context, format string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		d.tick(ctx, format)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Downloader) tick(ctx context.Context, format string) {
+	for _, record := range d.due() {
+		select {
+		case d.sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		go func(record downloadRecord) {
+			defer func() { <-d.sem }()
+			d.download(ctx, record, format)
+		}(record)
+	}
+	d.gc()
+}
+
+func (d *Downloader) due() []downloadRecord {
+	var records []downloadRecord
+	now := time.Now()
+	_ = d.DB.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(downloadsBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var record downloadRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return nil
+			}
+			if record.State == StateQueued || (record.State == StateFailed && !record.NextRetry.After(now)) {
+				records = append(records, record)
+			}
+			return nil
+		})
+	})
+	return records
+}
+
+func (d *Downloader) download(ctx context.Context, record downloadRecord, format string) {
+	record.State = StateDownloading
+	record.UpdatedAt = time.Now()
+	if err := d.put(record); err != nil {
+		log.Printf("could not mark %s as downloading: %s\n", record.VideoId, err)
+		return
+	}
+
+	if err := os.MkdirAll(d.MediaDir, 0700); err != nil {
+		d.fail(record, fmt.Errorf("could not create media directory: %w", err))
+		return
+	}
+	dest := filepath.Join(d.MediaDir, record.VideoId+".%(ext)s")
+	args := []string{fmt.Sprintf("--format=%s", format), "--output", dest, fmt.Sprintf("https://youtube.com/watch?v=%s", record.VideoId)}
+	cmd := exec.CommandContext(ctx, d.YtdlCommand, args...)
+	if err := cmd.Run(); err != nil {
+		d.fail(record, fmt.Errorf("yt-dlp failed: %w", err))
+		return
+	}
+
+	path, err := findDownloaded(d.MediaDir, record.VideoId)
+	if err != nil {
+		d.fail(record, err)
+		return
+	}
+
+	if d.Audio {
+		audioPath := filepath.Join(d.MediaDir, record.VideoId+"."+d.AudioFormat)
+		if err := transcodeAudio(ctx, d.FfmpegCommand, path, audioPath, d.AudioBitrate, record.Meta); err != nil {
+			d.fail(record, err)
+			return
+		}
+		if err := os.Remove(path); err != nil {
+			log.Printf("could not remove raw download %s after transcoding: %s\n", path, err)
+		}
+		path = audioPath
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		d.fail(record, fmt.Errorf("could not stat downloaded file: %w", err))
+		return
+	}
+
+	record.State = StateDone
+	record.Path = path
+	record.Size = info.Size()
+	record.Attempts = 0
+	record.Error = ""
+	record.UpdatedAt = time.Now()
+	if err := d.put(record); err != nil {
+		log.Printf("could not mark %s as done: %s\n", record.VideoId, err)
+	}
+}
+
+func (d *Downloader) fail(record downloadRecord, cause error) {
+	record.State = StateFailed
+	record.Attempts++
+	record.Error = cause.Error()
+	record.UpdatedAt = time.Now()
+	record.NextRetry = time.Now().Add(downloadBackoff(record.Attempts))
+	if err := d.put(record); err != nil {
+		log.Printf("could not mark %s as failed: %s\n", record.VideoId, err)
+	}
+	log.Printf("download of %s failed (attempt %d): %s\n", record.VideoId, record.Attempts, cause)
+}
+
+func downloadBackoff(attempt int) time.Duration {
+	backoff := time.Duration(1<<min(attempt, 6)) * time.Minute
+	return min(backoff, 6*time.Hour)
+}
+
+func findDownloaded(mediaDir, videoId string) (string, error) {
+	entries, err := os.ReadDir(mediaDir)
+	if err != nil {
+		return "", fmt.Errorf("could not list media directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), videoId+".") {
+			return filepath.Join(mediaDir, entry.Name()), nil
+		}
+	}
+	return "", fmt.Errorf("yt-dlp did not produce an output file for %s", videoId)
+}
+
+// gc removes downloaded files older than MaxAge, and - if MaxBytes is set -
+// the oldest files beyond the configured size quota.
+func (d *Downloader) gc() {
+	var records []downloadRecord
+	_ = d.DB.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(downloadsBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var record downloadRecord
+			if err := json.Unmarshal(v, &record); err == nil && record.State == StateDone {
+				records = append(records, record)
+			}
+			return nil
+		})
+	})
+	sort.Slice(records, func(i, j int) bool { return records[i].UpdatedAt.Before(records[j].UpdatedAt) })
+
+	var total int64
+	for _, record := range records {
+		total += record.Size
+	}
+
+	now := time.Now()
+	for _, record := range records {
+		expired := d.MaxAge > 0 && now.Sub(record.UpdatedAt) > d.MaxAge
+		overQuota := d.MaxBytes > 0 && total > d.MaxBytes
+		if !expired && !overQuota {
+			continue
+		}
+		if err := os.Remove(record.Path); err != nil && !os.IsNotExist(err) {
+			log.Printf("could not remove expired download %s: %s\n", record.Path, err)
+			continue
+		}
+		total -= record.Size
+		if err := d.DB.Update(func(tx *bbolt.Tx) error {
+			b := tx.Bucket(downloadsBucket)
+			if b == nil {
+				return nil
+			}
+			return b.Delete([]byte(record.VideoId))
+		}); err != nil {
+			log.Printf("could not remove download record for %s: %s\n", record.VideoId, err)
+		}
+	}
+}
@@ -2,12 +2,18 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/coreos/go-systemd/activation"
@@ -20,6 +26,77 @@ type Server struct {
 	YtdlCommand string
 	Format      string
 	Svc         YtSerice
+	Downloader  *Downloader
+
+	// FfmpegCommand and AudioBitrate are used for on-demand ?format=audio
+	// requests when no Downloader is configured to cache the result.
+	FfmpegCommand string
+	AudioBitrate  string
+
+	// Defaults for the exclude* query params, overridable per request.
+	ExcludeLive     bool
+	ExcludeShorts   bool
+	ExcludeUnlisted bool
+	PremiereMaxAge  time.Duration
+	PostLiveDelay   time.Duration
+}
+
+// channelOptions builds the Option set shared by channel and podcastChannel
+// from the request query, each query param falling back to the matching
+// Server default when absent or unparsable.
+func (s *Server) channelOptions(query url.Values, limit int, format, mimeType string) []Option {
+	opts := []Option{
+		WithLimit(limit),
+		WithFormat(format),
+		WithEnclosureBase(s.BaseUrl),
+		WithMimeType(mimeType),
+		WithExcludeLive(queryBool(query, "excludeLive", s.ExcludeLive)),
+		WithExcludeShorts(queryBool(query, "excludeShorts", s.ExcludeShorts)),
+		WithExcludeUnlisted(queryBool(query, "excludeUnlisted", s.ExcludeUnlisted)),
+		WithPostLiveDelay(queryDuration(query, "postLiveDelay", s.PostLiveDelay)),
+	}
+	if premiereMaxAge := queryDuration(query, "premiereMaxAge", s.PremiereMaxAge); premiereMaxAge > 0 {
+		opts = append(opts, WithExcludePremiereMaxAge(premiereMaxAge))
+	}
+	if s.Downloader != nil && s.Downloader.Audio {
+		opts = append(opts, WithAudioOutput(s.Downloader.AudioFormat, audioMimeType(s.Downloader.AudioFormat)))
+	}
+	return opts
+}
+
+func queryBool(query url.Values, key string, def bool) bool {
+	if v, err := strconv.ParseBool(query.Get(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+func queryDuration(query url.Values, key string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(query.Get(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+// queryDefaults reads the limit/format/mimeType query params shared by every
+// feed-producing handler, falling back to the matching Server default when a
+// param is absent or unparsable.
+func (s *Server) queryDefaults(query url.Values) (limit int, format, mimeType string) {
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit == 0 {
+		limit = s.Limit
+	}
+
+	format = query.Get("format")
+	if len(format) == 0 {
+		format = s.Format
+	}
+
+	mimeType = query.Get("mimeType")
+	if len(mimeType) == 0 {
+		mimeType = s.MimeType
+	}
+	return limit, format, mimeType
 }
 
 func (s *Server) channel(rw http.ResponseWriter, r *http.Request) {
@@ -30,39 +107,189 @@ func (s *Server) channel(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 	query := r.URL.Query()
-	limit, err := strconv.Atoi(query.Get("limit"))
-	if err != nil || limit == 0 {
-		limit = s.Limit
+	limit, format, mimeType := s.queryDefaults(query)
+
+	if query.Get("feed") == "podcast" {
+		s.podcastChannel(rw, r, channelId, limit, format, mimeType)
+		return
 	}
 
-	mimeType := query.Get("mimeType")
-	if len(mimeType) == 0 {
-		mimeType = s.MimeType
+	channel, err := s.Svc.Channel(r.Context(), channelId, s.channelOptions(query, limit, format, mimeType)...)
+	if err != nil {
+		http.Error(rw, "could not read channel information", http.StatusBadRequest)
+		log.Println(err)
+		return
 	}
 
-	format := query.Get("format")
-	if len(format) == 0 {
-		format = s.Format
+	if s.Downloader != nil {
+		for _, item := range channel.Items {
+			if item.Enclosure == nil {
+				continue
+			}
+			if _, size, ok := s.Downloader.Lookup(item.Id); ok {
+				item.Enclosure.Length = strconv.FormatInt(size, 10)
+				continue
+			}
+			meta := AudioMeta{
+				Title:     item.Title,
+				Artist:    channel.Title,
+				Album:     channel.Title,
+				Date:      item.Created.Format(time.RFC3339),
+				Thumbnail: videoThumbnail(item.Id),
+				Chapters:  chaptersFromDescription(item.Description),
+			}
+			if err := s.Downloader.Enqueue(item.Id, meta); err != nil {
+				log.Printf("could not enqueue %s for download: %s\n", item.Id, err)
+			}
+		}
 	}
 
-	channel, err := s.Svc.Channel(r.Context(), channelId,
-		WithLimit(limit),
-		WithFormat(format),
-		WithEnclosureBase(s.BaseUrl),
-		WithMimeType(mimeType))
+	if err := channel.WriteRss(rw); err != nil {
+		log.Println(err)
+		http.Error(rw, "could not map channel to rss", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) podcastChannel(rw http.ResponseWriter, r *http.Request, channelId string, limit int, format, mimeType string) {
+	podcastSvc, ok := s.Svc.(PodcastCapable)
+	if !ok {
+		http.Error(rw, "podcast feed is not supported by the configured backend", http.StatusNotImplemented)
+		return
+	}
+	channel, err := podcastSvc.PodcastChannel(r.Context(), channelId, s.channelOptions(r.URL.Query(), limit, format, mimeType)...)
 	if err != nil {
 		http.Error(rw, "could not read channel information", http.StatusBadRequest)
 		log.Println(err)
 		return
 	}
+	if err := channel.WritePodcastRss(rw); err != nil {
+		log.Println(err)
+		http.Error(rw, "could not map channel to podcast rss", http.StatusInternalServerError)
+		return
+	}
+}
 
+func (s *Server) playlist(rw http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s\n", r.Method, r.URL)
+	msSvc, ok := s.Svc.(MultiSourceCapable)
+	if !ok {
+		http.Error(rw, "playlists are not supported by the configured backend", http.StatusNotImplemented)
+		return
+	}
+	playlistId := r.PathValue("playlist")
+	if len(playlistId) == 0 {
+		http.Error(rw, "playlist id must not be empty", http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	limit, format, mimeType := s.queryDefaults(query)
+
+	channel, err := msSvc.Playlist(r.Context(), playlistId, s.channelOptions(query, limit, format, mimeType)...)
+	if err != nil {
+		http.Error(rw, "could not read playlist information", http.StatusBadRequest)
+		log.Println(err)
+		return
+	}
 	if err := channel.WriteRss(rw); err != nil {
 		log.Println(err)
-		http.Error(rw, "could not map channel to rss", http.StatusInternalServerError)
+		http.Error(rw, "could not map playlist to rss", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) search(rw http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s\n", r.Method, r.URL)
+	msSvc, ok := s.Svc.(MultiSourceCapable)
+	if !ok {
+		http.Error(rw, "search is not supported by the configured backend", http.StatusNotImplemented)
+		return
+	}
+	query := r.URL.Query()
+	q := query.Get("q")
+	if len(q) == 0 {
+		http.Error(rw, "missing search query parameter q", http.StatusBadRequest)
+		return
+	}
+	limit, format, mimeType := s.queryDefaults(query)
+
+	channel, err := msSvc.Search(r.Context(), q, s.channelOptions(query, limit, format, mimeType)...)
+	if err != nil {
+		http.Error(rw, "could not run search", http.StatusBadRequest)
+		log.Println(err)
+		return
+	}
+	if err := channel.WriteRss(rw); err != nil {
+		log.Println(err)
+		http.Error(rw, "could not map search results to rss", http.StatusInternalServerError)
 		return
 	}
 }
 
+// merge combines several channels into one feed, newest items first. The
+// result is paginated via an opaque cursor: the next page's cursor is
+// returned in the X-Next-Cursor header, since RSS has no pagination link of
+// its own.
+func (s *Server) merge(rw http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s\n", r.Method, r.URL)
+	msSvc, ok := s.Svc.(MultiSourceCapable)
+	if !ok {
+		http.Error(rw, "merging channels is not supported by the configured backend", http.StatusNotImplemented)
+		return
+	}
+	query := r.URL.Query()
+	idsParam := query.Get("ids")
+	if len(idsParam) == 0 {
+		http.Error(rw, "missing ids query parameter", http.StatusBadRequest)
+		return
+	}
+	ids := strings.Split(idsParam, ",")
+	limit, format, mimeType := s.queryDefaults(query)
+	opts := s.channelOptions(query, limit, format, mimeType)
+	if cursor := query.Get("cursor"); len(cursor) > 0 {
+		opts = append(opts, WithCursor(cursor))
+	}
+
+	channel, nextCursor, err := msSvc.Merge(r.Context(), ids, opts...)
+	if err != nil {
+		http.Error(rw, "could not merge channels", http.StatusBadRequest)
+		log.Println(err)
+		return
+	}
+	if len(nextCursor) > 0 {
+		rw.Header().Set("X-Next-Cursor", nextCursor)
+	}
+	if err := channel.WriteRss(rw); err != nil {
+		log.Println(err)
+		http.Error(rw, "could not map merged channels to rss", http.StatusInternalServerError)
+		return
+	}
+}
+
+// chapters serves the podcast:chapters JSON document for a video. It
+// re-derives the chapters from the video's description via yt-dlp rather
+// than replaying anything stashed from an earlier feed request, so the url
+// podcast:chapters points at keeps working across restarts and regardless of
+// which feed request (if any) a client fetched first.
+func (s *Server) chapters(rw http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s\n", r.Method, r.URL)
+	videoId := strings.TrimSuffix(r.PathValue("video"), ".json")
+	meta, err := s.videoAudioMeta(r.Context(), videoId)
+	if err != nil {
+		http.Error(rw, "could not load video metadata", http.StatusBadGateway)
+		log.Println(err)
+		return
+	}
+	if len(meta.Chapters) == 0 {
+		http.NotFound(rw, r)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(newPodcastChaptersDocument(meta.Chapters)); err != nil {
+		log.Println(err)
+	}
+}
+
 func (s *Server) watch(rw http.ResponseWriter, r *http.Request) {
 	log.Printf("%s %s\n", r.Method, r.URL)
 	query := r.URL.Query()
@@ -75,6 +302,17 @@ func (s *Server) watch(rw http.ResponseWriter, r *http.Request) {
 	if len(format) == 0 {
 		format = s.Format
 	}
+
+	if format == "audio" {
+		s.watchAudio(rw, r, vId)
+		return
+	}
+
+	if s.Downloader != nil {
+		s.watchLocal(rw, r, vId)
+		return
+	}
+
 	url, err := s.getUrl(vId, format)
 	if err != nil {
 		http.Error(rw, "extracting video url failed", http.StatusInternalServerError)
@@ -84,8 +322,122 @@ func (s *Server) watch(rw http.ResponseWriter, r *http.Request) {
 	http.Redirect(rw, r, url, http.StatusTemporaryRedirect)
 }
 
+// videoThumbnail returns the well-known static thumbnail url YouTube serves
+// for every video id, so callers that only have an id (no Data API snippet
+// at hand) can still embed cover art.
+func videoThumbnail(videoId string) string {
+	return fmt.Sprintf("https://i.ytimg.com/vi/%s/hqdefault.jpg", videoId)
+}
+
+// watchLocal serves a video out of the Downloader's on-disk store, so
+// listeners get real range-request support instead of a redirect to a
+// yt-dlp-resolved url that expires and can't be scrubbed.
+func (s *Server) watchLocal(rw http.ResponseWriter, r *http.Request, vId string) {
+	if path, _, ok := s.Downloader.Lookup(vId); ok {
+		http.ServeFile(rw, r, path)
+		return
+	}
+	meta, err := s.videoAudioMeta(r.Context(), vId)
+	if err != nil {
+		log.Printf("could not fetch metadata for %s, tagging audio with defaults: %s\n", vId, err)
+	}
+	if err := s.Downloader.Enqueue(vId, meta); err != nil {
+		http.Error(rw, "could not queue video for download", http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+	rw.Header().Set("Retry-After", "60")
+	http.Error(rw, "video is not downloaded yet, try again shortly", http.StatusServiceUnavailable)
+}
+
+// videoAudioMeta builds the AudioMeta for a video id reached directly
+// through /watch, i.e. without ever going through a channel listing that
+// already carries its title, channel and publish date. It always carries a
+// Thumbnail, since that needs no lookup; Title/Artist/Album/Date/Chapters
+// are filled in from a yt-dlp metadata dump when that succeeds.
+func (s *Server) videoAudioMeta(ctx context.Context, videoId string) (AudioMeta, error) {
+	meta := AudioMeta{Thumbnail: videoThumbnail(videoId)}
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.YtdlCommand, "--dump-json", fmt.Sprintf("https://youtube.com/watch?v=%s", videoId))
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return meta, fmt.Errorf("could not fetch video metadata: %w", err)
+	}
+
+	var dump struct {
+		Title       string `json:"title"`
+		Uploader    string `json:"uploader"`
+		UploadDate  string `json:"upload_date"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &dump); err != nil {
+		return meta, fmt.Errorf("could not parse video metadata: %w", err)
+	}
+
+	meta.Title = dump.Title
+	meta.Artist = dump.Uploader
+	meta.Album = dump.Uploader
+	meta.Chapters = chaptersFromDescription(dump.Description)
+	if uploaded, err := time.Parse("20060102", dump.UploadDate); err == nil {
+		meta.Date = uploaded.Format(time.RFC3339)
+	}
+	return meta, nil
+}
+
+// watchAudio serves vId transcoded to audio. If a Downloader with Audio
+// enabled is configured, it is served out of that store like watchLocal.
+// Otherwise the video is downloaded and transcoded on demand into a
+// temporary file so http.ServeFile can still offer Content-Length and range
+// support.
+func (s *Server) watchAudio(rw http.ResponseWriter, r *http.Request, vId string) {
+	if s.Downloader != nil && s.Downloader.Audio {
+		s.watchLocal(rw, r, vId)
+		return
+	}
+
+	meta, err := s.videoAudioMeta(r.Context(), vId)
+	if err != nil {
+		log.Printf("could not fetch metadata for %s, tagging audio with defaults: %s\n", vId, err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "yt2rss-audio-")
+	if err != nil {
+		http.Error(rw, "could not create temporary directory", http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	rawDest := filepath.Join(tmpDir, vId+".%(ext)s")
+	args := []string{fmt.Sprintf("--format=%s", s.Format), "--output", rawDest, fmt.Sprintf("https://youtube.com/watch?v=%s", vId)}
+	if err := exec.CommandContext(r.Context(), s.YtdlCommand, args...).Run(); err != nil {
+		http.Error(rw, "downloading video failed", http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+	rawPath, err := findDownloaded(tmpDir, vId)
+	if err != nil {
+		http.Error(rw, "downloading video failed", http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+
+	audioPath := filepath.Join(tmpDir, vId+".mp3")
+	if err := transcodeAudio(r.Context(), s.FfmpegCommand, rawPath, audioPath, s.AudioBitrate, meta); err != nil {
+		http.Error(rw, "transcoding audio failed", http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+	http.ServeFile(rw, r, audioPath)
+}
+
 func (s *Server) Run(addr string) error {
 	sm := http.NewServeMux()
+	sm.HandleFunc("GET /playlist/{playlist}", s.playlist)
+	sm.HandleFunc("GET /search", s.search)
+	sm.HandleFunc("GET /merge", s.merge)
+	sm.HandleFunc("GET /chapters/{video}", s.chapters)
 	sm.HandleFunc("GET /{channel}", s.channel)
 	sm.HandleFunc("GET /watch", s.watch)
 	sockets, err := activation.Listeners()
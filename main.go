@@ -10,6 +10,7 @@ import (
 	"os"
 	"path"
 	"strconv"
+	"time"
 
 	"go.etcd.io/bbolt"
 )
@@ -50,6 +51,28 @@ func intEnv(key string, def int) int {
 	return def
 }
 
+func boolEnv(key string, def bool) bool {
+	if val, ok := os.LookupEnv(key); ok {
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return b
+	}
+	return def
+}
+
+func durationEnv(key string, def time.Duration) time.Duration {
+	if val, ok := os.LookupEnv(key); ok {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return d
+	}
+	return def
+}
+
 func printVersion() {
 	fmt.Println(yt2rssAsciiArt)
 	fmt.Println("yt2rss: Bridge the youtube API to RSS")
@@ -71,6 +94,21 @@ func main() {
 	var addr string
 	var mode string
 	var version bool
+	var feed string
+	var mediaDir string
+	var maxConcurrentDownloads int
+	var maxAgeDays int
+	var maxSizeMb int64
+	var ffmpegCommand string
+	var audioBitrate string
+	var audio bool
+	var audioFormat string
+	var backend string
+	var excludeLive bool
+	var excludeShorts bool
+	var excludeUnlisted bool
+	var premiereMaxAge time.Duration
+	var postLiveDelay time.Duration
 
 	flag.IntVar(&limit, "l", intEnv("YT2RSS_LIMIT", math.MaxInt), "Limit the number of items returned to l")
 	flag.StringVar(&mode, "m", env("YT2RSS_MODE", "single"), "Serve for server mode and single for oneshot")
@@ -80,6 +118,21 @@ func main() {
 	flag.StringVar(&apiKey, "k", env("YT2RSS_API_KEY", ""), "The API Key for the youtube data api v3")
 	flag.StringVar(&baseUrl, "b", env("YT2RSS_BASE_URL", "http://localhost:9494"), "The url under which the server is reachable in serve mode")
 	flag.StringVar(&addr, "p", env("YT2RSS_ADDR", ":9494"), "The addresse to bind")
+	flag.StringVar(&feed, "feed", env("YT2RSS_FEED", "rss"), "Feed format to emit: rss or podcast")
+	flag.StringVar(&mediaDir, "d", env("YT2RSS_MEDIA_DIR", ""), "Media directory to download videos into for serve-local mode")
+	flag.IntVar(&maxConcurrentDownloads, "dc", intEnv("YT2RSS_MAX_CONCURRENT_DOWNLOADS", 2), "Maximum number of concurrent downloads in serve-local mode")
+	flag.IntVar(&maxAgeDays, "da", intEnv("YT2RSS_MAX_AGE_DAYS", 30), "Delete downloaded files older than this many days in serve-local mode. 0 disables age-based cleanup")
+	flag.Int64Var(&maxSizeMb, "ds", int64(intEnv("YT2RSS_MAX_SIZE_MB", 0)), "Delete the oldest downloaded files once the media directory exceeds this many megabytes in serve-local mode. 0 disables the quota")
+	flag.StringVar(&ffmpegCommand, "ffmpeg", env("YT2RSS_FFMPEG_COMMAND", "ffmpeg"), "The command to use to transcode videos to audio for ?format=audio")
+	flag.StringVar(&audioBitrate, "ab", env("YT2RSS_AUDIO_BITRATE", "128k"), "Audio bitrate to transcode to for ?format=audio")
+	flag.BoolVar(&audio, "audio", env("YT2RSS_AUDIO", "") != "", "In serve-local mode, transcode every download to audio instead of keeping the video")
+	flag.StringVar(&audioFormat, "af", env("YT2RSS_AUDIO_FORMAT", "mp3"), "Audio file extension to transcode to in serve-local mode when -audio is set")
+	flag.StringVar(&backend, "backend", env("YT2RSS_BACKEND", "api"), "Backend to fetch channel information with: api (YouTube Data API, requires -k) or ytdlp (scrapes via yt-dlp, no API key needed)")
+	flag.BoolVar(&excludeLive, "xl", boolEnv("YT2RSS_EXCLUDE_LIVE", false), "Exclude videos that are currently live")
+	flag.BoolVar(&excludeShorts, "xs", boolEnv("YT2RSS_EXCLUDE_SHORTS", false), "Exclude videos under a minute long")
+	flag.BoolVar(&excludeUnlisted, "xu", boolEnv("YT2RSS_EXCLUDE_UNLISTED", false), "Exclude unlisted videos")
+	flag.DurationVar(&premiereMaxAge, "xp", durationEnv("YT2RSS_PREMIERE_MAX_AGE", 0), "Exclude premieres scheduled longer than this ago that never went live. 0 disables this filter")
+	flag.DurationVar(&postLiveDelay, "ld", durationEnv("YT2RSS_POST_LIVE_DELAY", 0), "Hold back a livestream for this long after it ends, so its VOD url has time to settle")
 	flag.BoolVar(&version, "v", false, "Print version info and exit")
 	flag.Parse()
 
@@ -88,26 +141,80 @@ func main() {
 		os.Exit(0)
 	}
 
-	var svc YtSerice = &YoutubeAPIService{ApiKey: apiKey, Cache: openCache()}
+	svc, err := newYtSerice(backend, apiKey, ytdlCommand)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	switch {
 	case len(flag.Args()) == 0 && mode == "serve":
 		server := Server{
-			BaseUrl:     baseUrl,
-			Limit:       limit,
-			MimeType:    mimeType,
-			YtdlCommand: ytdlCommand,
-			Format:      format,
-			Svc:         svc,
+			BaseUrl:         baseUrl,
+			Limit:           limit,
+			MimeType:        mimeType,
+			YtdlCommand:     ytdlCommand,
+			Format:          format,
+			Svc:             svc,
+			FfmpegCommand:   ffmpegCommand,
+			AudioBitrate:    audioBitrate,
+			ExcludeLive:     excludeLive,
+			ExcludeShorts:   excludeShorts,
+			ExcludeUnlisted: excludeUnlisted,
+			PremiereMaxAge:  premiereMaxAge,
+			PostLiveDelay:   postLiveDelay,
 		}
 		if err := server.Run(addr); err != nil {
 			log.Fatal(err)
 		}
+	case len(flag.Args()) == 0 && mode == "serve-local":
+		if len(mediaDir) == 0 {
+			log.Fatal("-d (media directory) is required in serve-local mode")
+		}
+		downloader, err := openDownloader(mediaDir, ytdlCommand, maxConcurrentDownloads, maxAgeDays, maxSizeMb)
+		if err != nil {
+			log.Fatal(err)
+		}
+		downloader.Audio = audio
+		downloader.AudioFormat = audioFormat
+		downloader.AudioBitrate = audioBitrate
+		downloader.FfmpegCommand = ffmpegCommand
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go downloader.Run(ctx, format, time.Minute)
+
+		server := Server{
+			BaseUrl:         baseUrl,
+			Limit:           limit,
+			MimeType:        mimeType,
+			YtdlCommand:     ytdlCommand,
+			Format:          format,
+			Svc:             svc,
+			Downloader:      downloader,
+			FfmpegCommand:   ffmpegCommand,
+			AudioBitrate:    audioBitrate,
+			ExcludeLive:     excludeLive,
+			ExcludeShorts:   excludeShorts,
+			ExcludeUnlisted: excludeUnlisted,
+			PremiereMaxAge:  premiereMaxAge,
+			PostLiveDelay:   postLiveDelay,
+		}
+		if err := server.Run(addr); err != nil {
+			log.Fatal(err)
+		}
+	case len(flag.Args()) == 1 && mode == "single" && feed == "podcast":
+		podcastSvc, ok := svc.(PodcastCapable)
+		if !ok {
+			log.Fatal("podcast feed is not supported by the configured backend")
+		}
+		channel, err := podcastSvc.PodcastChannel(context.Background(), flag.Arg(0), singleModeOptions(limit, format, mimeType, excludeLive, excludeShorts, excludeUnlisted, premiereMaxAge, postLiveDelay)...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if channel.WritePodcastRss(os.Stdout) != nil {
+			log.Fatal(err)
+		}
 	case len(flag.Args()) == 1 && mode == "single":
-		channel, err := svc.Channel(context.Background(), flag.Arg(0),
-			WithLimit(limit),
-			WithFormat(format),
-			WithMimeType(mimeType))
+		channel, err := svc.Channel(context.Background(), flag.Arg(0), singleModeOptions(limit, format, mimeType, excludeLive, excludeShorts, excludeUnlisted, premiereMaxAge, postLiveDelay)...)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -121,6 +228,33 @@ func main() {
 
 }
 
+func singleModeOptions(limit int, format, mimeType string, excludeLive, excludeShorts, excludeUnlisted bool, premiereMaxAge, postLiveDelay time.Duration) []Option {
+	opts := []Option{
+		WithLimit(limit),
+		WithFormat(format),
+		WithMimeType(mimeType),
+		WithExcludeLive(excludeLive),
+		WithExcludeShorts(excludeShorts),
+		WithExcludeUnlisted(excludeUnlisted),
+		WithPostLiveDelay(postLiveDelay),
+	}
+	if premiereMaxAge > 0 {
+		opts = append(opts, WithExcludePremiereMaxAge(premiereMaxAge))
+	}
+	return opts
+}
+
+func newYtSerice(backend, apiKey, ytdlCommand string) (YtSerice, error) {
+	switch backend {
+	case "api":
+		return &YoutubeAPIService{ApiKey: apiKey, Cache: openCache()}, nil
+	case "ytdlp":
+		return &ScraperService{YtdlCommand: ytdlCommand, Cache: openCache()}, nil
+	default:
+		return nil, fmt.Errorf("unknown backend %q, expected api or ytdlp", backend)
+	}
+}
+
 func openCache() *Cache {
 	cacheDir, err := os.UserCacheDir()
 	if err != nil {
@@ -139,3 +273,16 @@ func openCache() *Cache {
 
 	return &Cache{DB: cache}
 }
+
+func openDownloader(mediaDir, ytdlCommand string, maxConcurrent int, maxAgeDays int, maxSizeMb int64) (*Downloader, error) {
+	if err := os.MkdirAll(mediaDir, 0700); err != nil {
+		return nil, fmt.Errorf("could not create media directory: %w", err)
+	}
+	db, err := bbolt.Open(path.Join(mediaDir, "downloads.db"), 0600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not open download state database: %w", err)
+	}
+	maxAge := time.Duration(maxAgeDays) * 24 * time.Hour
+	maxBytes := maxSizeMb * 1024 * 1024
+	return NewDownloader(db, mediaDir, ytdlCommand, maxConcurrent, maxAge, maxBytes), nil
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/feeds"
+)
+
+// PodcastFeed is a feeds.Feed enriched with the iTunes and Podcast Index
+// namespace fields needed to render a feed podcast clients handle well.
+type PodcastFeed struct {
+	*feeds.Feed
+	Author     string
+	Owner      *PodcastPerson
+	Explicit   bool
+	Categories []string
+	Items      []*PodcastItem
+}
+
+type PodcastPerson struct {
+	Name  string
+	Email string
+}
+
+// PodcastItem is a feeds.Item enriched with the per-episode podcast fields.
+type PodcastItem struct {
+	*feeds.Item
+	Duration string // formatted as HH:MM:SS, as expected by itunes:duration
+	Explicit bool
+	Image    string
+	// ChaptersUrl points at the JSON document /chapters/{id}.json serves for
+	// this item, per the Podcast Index podcast:chapters spec. Empty when the
+	// item has no chapters or no base url was configured to host it under.
+	ChaptersUrl string
+	Guid        string
+}
+
+type PodcastChapter struct {
+	StartTime float64
+	Title     string
+}
+
+// podcastChaptersDocument is the JSON document shape the Podcast Index
+// podcast:chapters tag's url attribute points at.
+type podcastChaptersDocument struct {
+	Version  string                 `json:"version"`
+	Chapters []podcastChaptersEntry `json:"chapters"`
+}
+
+type podcastChaptersEntry struct {
+	StartTime float64 `json:"startTime"`
+	Title     string  `json:"title"`
+}
+
+func newPodcastChaptersDocument(chapters []PodcastChapter) podcastChaptersDocument {
+	entries := make([]podcastChaptersEntry, len(chapters))
+	for i, c := range chapters {
+		entries[i] = podcastChaptersEntry{StartTime: c.StartTime, Title: c.Title}
+	}
+	return podcastChaptersDocument{Version: "1.2.0", Chapters: entries}
+}
+
+// youtubeCategoryToItunes maps a subset of YouTube video category ids to the
+// closest matching iTunes podcast category. Categories with no reasonable
+// match fall back to "TV & Film".
+var youtubeCategoryToItunes = map[string]string{
+	"1":  "TV & Film",
+	"10": "Music",
+	"15": "Leisure",
+	"17": "Sports",
+	"19": "Leisure",
+	"20": "Games & Hobbies",
+	"22": "Society & Culture",
+	"23": "Comedy",
+	"24": "Arts",
+	"25": "News",
+	"26": "Health & Fitness",
+	"27": "Education",
+	"28": "Technology",
+}
+
+func itunesCategory(youtubeCategoryId string) string {
+	if cat, ok := youtubeCategoryToItunes[youtubeCategoryId]; ok {
+		return cat
+	}
+	return "TV & Film"
+}
+
+// chapterPattern matches description lines starting with a mm:ss or h:mm:ss
+// timestamp, e.g. "00:00 Intro" or "1:02:03 - Outro".
+var chapterPattern = regexp.MustCompile(`(?m)^\s*(\d{1,2}(?::\d{2}){1,2})\s*[-:]?\s*(.+)$`)
+
+// chaptersFromDescription extracts podcast:chapters entries from timestamps
+// commonly found in YouTube video descriptions.
+func chaptersFromDescription(description string) []PodcastChapter {
+	var chapters []PodcastChapter
+	for _, match := range chapterPattern.FindAllStringSubmatch(description, -1) {
+		seconds, err := parseTimestamp(match[1])
+		if err != nil {
+			continue
+		}
+		chapters = append(chapters, PodcastChapter{StartTime: seconds, Title: strings.TrimSpace(match[2])})
+	}
+	return chapters
+}
+
+func parseTimestamp(ts string) (float64, error) {
+	parts := strings.Split(ts, ":")
+	var seconds float64
+	for _, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return 0, err
+		}
+		seconds = seconds*60 + float64(n)
+	}
+	return seconds, nil
+}
+
+// isoDurationPattern matches the ISO 8601 duration format YouTube reports in
+// contentDetails.duration, e.g. "PT1H2M3S".
+var isoDurationPattern = regexp.MustCompile(`^PT(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?$`)
+
+// parseISO8601Duration converts a contentDetails.duration value into a
+// duration formatted as HH:MM:SS, as expected by itunes:duration.
+func parseISO8601Duration(iso string) (string, error) {
+	hours, minutes, seconds, err := parseISO8601DurationParts(iso)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%02d:%02d:%02d", hours, minutes, seconds), nil
+}
+
+// parseISO8601Seconds converts a contentDetails.duration value into a total
+// number of seconds, e.g. to compare it against a shorts duration cutoff.
+func parseISO8601Seconds(iso string) (int, error) {
+	hours, minutes, seconds, err := parseISO8601DurationParts(iso)
+	if err != nil {
+		return 0, err
+	}
+	return hours*3600 + minutes*60 + seconds, nil
+}
+
+func parseISO8601DurationParts(iso string) (hours, minutes, seconds int, err error) {
+	match := isoDurationPattern.FindStringSubmatch(iso)
+	if match == nil {
+		return 0, 0, 0, fmt.Errorf("not a valid ISO 8601 duration: %s", iso)
+	}
+	hours, _ = strconv.Atoi(match[1])
+	minutes, _ = strconv.Atoi(match[2])
+	seconds, _ = strconv.Atoi(match[3])
+	return hours, minutes, seconds, nil
+}
+
+// The following types mirror the RSS 2.0 shape gorilla/feeds produces, but
+// add the itunes and podcast (Podcast Index) namespace elements that library
+// has no extension point for.
+
+type podcastRss struct {
+	XMLName   xml.Name          `xml:"rss"`
+	Version   string            `xml:"version,attr"`
+	NsItunes  string            `xml:"xmlns:itunes,attr"`
+	NsPodcast string            `xml:"xmlns:podcast,attr"`
+	NsContent string            `xml:"xmlns:content,attr"`
+	Channel   podcastRssChannel `xml:"channel"`
+}
+
+type podcastRssChannel struct {
+	Title          string               `xml:"title"`
+	Link           string               `xml:"link"`
+	Description    string               `xml:"description"`
+	Language       string               `xml:"language,omitempty"`
+	ItunesAuthor   string               `xml:"itunes:author,omitempty"`
+	ItunesOwner    *podcastRssOwner     `xml:"itunes:owner,omitempty"`
+	ItunesImage    *podcastRssImage     `xml:"itunes:image,omitempty"`
+	ItunesExplicit string               `xml:"itunes:explicit,omitempty"`
+	ItunesCategory []podcastRssCategory `xml:"itunes:category"`
+	PodcastGuid    string               `xml:"podcast:guid,omitempty"`
+	Items          []podcastRssItem     `xml:"item"`
+}
+
+type podcastRssOwner struct {
+	Name  string `xml:"itunes:name"`
+	Email string `xml:"itunes:email"`
+}
+
+type podcastRssImage struct {
+	Href string `xml:"href,attr"`
+}
+
+type podcastRssCategory struct {
+	Text string `xml:"text,attr"`
+}
+
+type podcastRssItem struct {
+	Title           string               `xml:"title"`
+	Link            string               `xml:"link"`
+	Guid            string               `xml:"guid"`
+	PubDate         string               `xml:"pubDate"`
+	Description     string               `xml:"description"`
+	Enclosure       *podcastRssEnclosure `xml:"enclosure"`
+	ItunesDuration  string               `xml:"itunes:duration,omitempty"`
+	ItunesExplicit  string               `xml:"itunes:explicit,omitempty"`
+	ItunesImage     *podcastRssImage     `xml:"itunes:image,omitempty"`
+	PodcastChapters *podcastRssChapters  `xml:"podcast:chapters,omitempty"`
+}
+
+type podcastRssEnclosure struct {
+	Url    string `xml:"url,attr"`
+	Length string `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type podcastRssChapters struct {
+	Url  string `xml:"url,attr"`
+	Type string `xml:"type,attr"`
+}
+
+func explicitFlag(explicit bool) string {
+	if explicit {
+		return "yes"
+	}
+	return "no"
+}
+
+// WritePodcastRss writes the feed as an RSS 2.0 document carrying the itunes
+// and podcast (Podcast Index) namespace extensions. gorilla/feeds has no hook
+// for these, so the document is built independently of feeds.Feed.WriteRss.
+func (p *PodcastFeed) WritePodcastRss(w io.Writer) error {
+	channel := podcastRssChannel{
+		Title:          p.Title,
+		Link:           p.Link.Href,
+		Description:    p.Description,
+		ItunesAuthor:   p.Author,
+		ItunesExplicit: explicitFlag(p.Explicit),
+		PodcastGuid:    p.Id,
+	}
+	if p.Image != nil {
+		channel.ItunesImage = &podcastRssImage{Href: p.Image.Url}
+	}
+	if p.Owner != nil {
+		channel.ItunesOwner = &podcastRssOwner{Name: p.Owner.Name, Email: p.Owner.Email}
+	}
+	for _, category := range p.Categories {
+		channel.ItunesCategory = append(channel.ItunesCategory, podcastRssCategory{Text: category})
+	}
+
+	for _, item := range p.Items {
+		rssItem := podcastRssItem{
+			Title:          item.Title,
+			Link:           item.Link.Href,
+			Guid:           item.Guid,
+			PubDate:        item.Created.Format(time.RFC1123Z),
+			Description:    item.Description,
+			ItunesDuration: item.Duration,
+			ItunesExplicit: explicitFlag(item.Explicit),
+		}
+		if rssItem.Guid == "" {
+			rssItem.Guid = item.Id
+		}
+		if item.Image != "" {
+			rssItem.ItunesImage = &podcastRssImage{Href: item.Image}
+		}
+		if item.ChaptersUrl != "" {
+			rssItem.PodcastChapters = &podcastRssChapters{Url: item.ChaptersUrl, Type: "application/json+chapters"}
+		}
+		if item.Enclosure != nil {
+			rssItem.Enclosure = &podcastRssEnclosure{Url: item.Enclosure.Url, Length: item.Enclosure.Length, Type: item.Enclosure.Type}
+		}
+		channel.Items = append(channel.Items, rssItem)
+	}
+
+	rss := podcastRss{
+		Version:   "2.0",
+		NsItunes:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		NsPodcast: "https://podcastindex.org/namespace/1.0",
+		NsContent: "http://purl.org/rss/1.0/modules/content/",
+		Channel:   channel,
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(rss)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/feeds"
+)
+
+// ScraperService is a YtSerice backend that delegates to `yt-dlp
+// --dump-single-json --flat-playlist` instead of the YouTube Data API, so it
+// works without a YT2RSS_API_KEY and its quota.
+type ScraperService struct {
+	YtdlCommand string
+	Cache       *Cache
+}
+
+type ytdlpPlaylist struct {
+	Title       string           `json:"title"`
+	Description string           `json:"description"`
+	ChannelId   string           `json:"channel_id"`
+	Thumbnails  []ytdlpThumbnail `json:"thumbnails"`
+	Entries     []ytdlpEntry     `json:"entries"`
+}
+
+type ytdlpThumbnail struct {
+	Url    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+type ytdlpEntry struct {
+	Id          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Timestamp   int64  `json:"timestamp"`
+	UploadDate  string `json:"upload_date"`
+
+	// Duration, LiveStatus, Availability and ReleaseTimestamp are the subset
+	// of exclude-filter-relevant fields yt-dlp's YouTube tab extractor fills
+	// in even under --flat-playlist, without the per-video fetch a full
+	// Videos.List-equivalent lookup would cost.
+	Duration         float64 `json:"duration"`
+	LiveStatus       string  `json:"live_status"` // "is_live", "is_upcoming", "was_live", "post_live", "not_live"
+	Availability     string  `json:"availability"`
+	ReleaseTimestamp int64   `json:"release_timestamp"`
+}
+
+// passesExcludeFilters applies the WithExclude*/WithPostLiveDelay predicates
+// to a flat-playlist entry, mirroring YoutubeAPIService's passesExcludeFilters
+// over the fields yt-dlp exposes here instead of a youtube.Video.
+func (e ytdlpEntry) passesExcludeFilters(o options) bool {
+	if o.excludeUnlisted && e.Availability == "unlisted" {
+		return false
+	}
+
+	switch e.LiveStatus {
+	case "is_live":
+		if o.excludeLive {
+			return false // currently live
+		}
+	case "is_upcoming":
+		if o.premiereMaxAge > 0 && e.ReleaseTimestamp != 0 {
+			scheduled := time.Unix(e.ReleaseTimestamp, 0)
+			if time.Since(scheduled) > o.premiereMaxAge {
+				return false // premiere that never went live, and is old enough to consider stale
+			}
+		}
+	case "post_live":
+		if o.postLiveDelay > 0 && time.Since(e.publishedAt()) < o.postLiveDelay {
+			return false // just-ended livestream, give the VOD url time to settle
+		}
+	}
+
+	if o.excludeShorts && e.Duration > 0 && e.Duration < 60 {
+		return false
+	}
+
+	return true
+}
+
+func (y *ScraperService) Channel(ctx context.Context, id string, o ...Option) (*feeds.Feed, error) {
+	options := defaultOptions
+	for _, opt := range o {
+		options = opt(options)
+	}
+
+	playlist, err := y.dumpPlaylist(ctx, channelVideosUrl(id), options.limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not load channel %s via %s: %w", id, y.YtdlCommand, err)
+	}
+	baseCacheKey := playlist.ChannelId
+	if len(baseCacheKey) == 0 {
+		baseCacheKey = id
+	}
+	cacheKey := cacheKeyWithFilters(baseCacheKey, options)
+
+	videos := make([]*feeds.Item, 0, len(playlist.Entries))
+	y.Cache.InvalidateCacheIfDirty(cacheKey, options.limit)
+	for _, entry := range playlist.Entries {
+		if options.excludesEnabled() && !entry.passesExcludeFilters(options) {
+			continue
+		}
+		video, err := y.mapToFeedItem(entry, options)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+		if y.Cache.HasItem(cacheKey, video) {
+			break
+		}
+	}
+	y.Cache.Put(cacheKey, videos...)
+	videos, err = topUpFromCache(y.Cache, cacheKey, videos, options.limit)
+	if err != nil {
+		return nil, err
+	}
+	y.Cache.UpdateMaxLimit(cacheKey, options.limit)
+
+	var thumbnail ytdlpThumbnail
+	if len(playlist.Thumbnails) > 0 {
+		thumbnail = playlist.Thumbnails[len(playlist.Thumbnails)-1]
+	}
+
+	return &feeds.Feed{
+		Title:       playlist.Title,
+		Image:       &feeds.Image{Url: thumbnail.Url, Width: thumbnail.Width, Height: thumbnail.Height},
+		Id:          baseCacheKey,
+		Link:        &feeds.Link{Href: channelUrl(id)},
+		Items:       videos,
+		Description: playlist.Description,
+	}, nil
+}
+
+func (y *ScraperService) mapToFeedItem(entry ytdlpEntry, o options) (*feeds.Item, error) {
+	enclosure, err := buildEnclosure(entry.Id, o)
+	if err != nil {
+		return nil, fmt.Errorf("could not format enclosure url: %w", err)
+	}
+	return &feeds.Item{
+		Title:       entry.Title,
+		Link:        &feeds.Link{Href: fmt.Sprintf("https://youtube.com/watch?v=%s", entry.Id)},
+		Id:          entry.Id,
+		Created:     entry.publishedAt(),
+		Description: entry.Description,
+		Enclosure:   enclosure,
+	}, nil
+}
+
+// publishedAt prefers the unix timestamp yt-dlp reports (populated thanks to
+// dumpPlaylist's youtubetab:approximate_date extractor arg; it's otherwise
+// left unset by --flat-playlist), falling back to the coarser YYYYMMDD
+// upload_date when that's all extraction returned.
+func (e ytdlpEntry) publishedAt() time.Time {
+	if e.Timestamp != 0 {
+		return time.Unix(e.Timestamp, 0).UTC()
+	}
+	if t, err := time.Parse("20060102", e.UploadDate); err == nil {
+		return t
+	}
+	return time.Time{}
+}
+
+func (y *ScraperService) dumpPlaylist(ctx context.Context, url string, limit int) (*ytdlpPlaylist, error) {
+	// youtubetab:approximate_date asks yt-dlp to derive a timestamp for each
+	// entry from its position in the tab instead of leaving it unset, since
+	// --flat-playlist never loads the individual video pages that carry a
+	// real one. Without it every entry would publish at the zero time.
+	args := []string{"--dump-single-json", "--flat-playlist", "--extractor-args", "youtubetab:approximate_date"}
+	if limit > 0 && limit != defaultOptions.limit {
+		args = append(args, "--playlist-end", strconv.Itoa(limit))
+	}
+	args = append(args, url)
+
+	var out, errBuf bytes.Buffer
+	cmd := exec.CommandContext(ctx, y.YtdlCommand, args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &errBuf
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(errBuf.String()))
+	}
+
+	var playlist ytdlpPlaylist
+	if err := json.Unmarshal(out.Bytes(), &playlist); err != nil {
+		return nil, fmt.Errorf("could not parse yt-dlp output: %w", err)
+	}
+	return &playlist, nil
+}
+
+func channelUrl(id string) string {
+	switch {
+	case strings.HasPrefix(id, "http"):
+		return id
+	case strings.HasPrefix(id, "@"):
+		return fmt.Sprintf("https://youtube.com/%s", id)
+	default:
+		return fmt.Sprintf("https://youtube.com/channel/%s", id)
+	}
+}
+
+func channelVideosUrl(id string) string {
+	return channelUrl(id) + "/videos"
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// AudioMeta carries the per-video metadata needed to tag a transcoded audio
+// file: ID3 title/artist/album/date and chapters parsed from the video
+// description.
+type AudioMeta struct {
+	Title     string
+	Artist    string
+	Album     string
+	Date      string
+	Thumbnail string
+	Chapters  []PodcastChapter
+}
+
+// audioMimeType maps a serve-local -af extension to the mime type its
+// transcoded output actually has, so the feed enclosure matches what -audio
+// produces instead of the raw download's type.
+func audioMimeType(ext string) string {
+	switch ext {
+	case "opus":
+		return "audio/ogg"
+	default:
+		return "audio/mpeg"
+	}
+}
+
+// transcodeAudio pipes a downloaded video file through ffmpeg, producing an
+// audio-only file at the given bitrate with cover art and ID3 tags embedded.
+func transcodeAudio(ctx context.Context, ffmpegCommand, src, dest, bitrate string, meta AudioMeta) error {
+	args := []string{"-y", "-i", src}
+	nextInput := 1
+
+	coverInput := -1
+	if len(meta.Thumbnail) > 0 {
+		args = append(args, "-i", meta.Thumbnail)
+		coverInput = nextInput
+		nextInput++
+	}
+
+	metadataInput := -1
+	var chapterFile string
+	if len(meta.Chapters) > 0 {
+		var err error
+		chapterFile, err = writeChapterMetadata(meta.Chapters, dest)
+		if err != nil {
+			return fmt.Errorf("could not write chapter metadata: %w", err)
+		}
+		defer os.Remove(chapterFile)
+		args = append(args, "-f", "ffmetadata", "-i", chapterFile)
+		metadataInput = nextInput
+		nextInput++
+	}
+
+	args = append(args, "-map", "0:a")
+	if coverInput >= 0 {
+		args = append(args, "-map", fmt.Sprintf("%d:v", coverInput), "-c:v", "copy", "-disposition:v", "attached_pic")
+	}
+	if metadataInput >= 0 {
+		args = append(args, "-map_metadata", fmt.Sprintf("%d", metadataInput))
+	}
+	args = append(args, "-b:a", bitrate)
+	args = append(args, id3Args(meta)...)
+	args = append(args, dest)
+
+	cmd := exec.CommandContext(ctx, ffmpegCommand, args...)
+	var errBuf strings.Builder
+	cmd.Stderr = &errBuf
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(errBuf.String()))
+	}
+	return nil
+}
+
+func id3Args(meta AudioMeta) []string {
+	var args []string
+	add := func(key, value string) {
+		if len(value) > 0 {
+			args = append(args, "-metadata", fmt.Sprintf("%s=%s", key, value))
+		}
+	}
+	add("title", meta.Title)
+	add("artist", meta.Artist)
+	add("album", meta.Album)
+	add("date", meta.Date)
+	return args
+}
+
+// writeChapterMetadata writes an ffmpeg ";FFMETADATA1" file describing
+// meta.Chapters, so transcodeAudio can carry them over into the output file.
+func writeChapterMetadata(chapters []PodcastChapter, dest string) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(dest), "chapters-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	fmt.Fprintln(f, ";FFMETADATA1")
+	for i, chapter := range chapters {
+		start := int64(chapter.StartTime * 1000)
+		end := int64(1 << 62)
+		if i+1 < len(chapters) {
+			end = int64(chapters[i+1].StartTime * 1000)
+		}
+		fmt.Fprintf(f, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n", start, end, chapter.Title)
+	}
+	return f.Name(), nil
+}
@@ -2,12 +2,14 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"iter"
 	"math"
 	"mime"
 	"net/url"
+	"sort"
 	"strings"
 	"time"
 
@@ -20,11 +22,40 @@ type YtSerice interface {
 	Channel(ctx context.Context, id string, o ...Option) (*feeds.Feed, error)
 }
 
+// PodcastCapable is implemented by YtSerice backends that can additionally
+// produce a PodcastFeed carrying the itunes/podcast namespace extensions.
+type PodcastCapable interface {
+	PodcastChannel(ctx context.Context, id string, o ...Option) (*PodcastFeed, error)
+}
+
+// MultiSourceCapable is implemented by YtSerice backends that can build a
+// feed from sources other than a single channel: a playlist id, a search
+// query, or a union of several channels merged by publish date.
+type MultiSourceCapable interface {
+	Playlist(ctx context.Context, playlistId string, o ...Option) (*feeds.Feed, error)
+	Search(ctx context.Context, query string, o ...Option) (*feeds.Feed, error)
+	// Merge returns the merged feed together with the cursor to pass as
+	// WithCursor on the next call to keep paging through older items, or ""
+	// once nothing is left to page through.
+	Merge(ctx context.Context, ids []string, o ...Option) (*feeds.Feed, string, error)
+}
+
 type options struct {
 	limit         int
 	format        string
 	mimetype      string
 	enclosureBase string
+
+	excludeLive     bool
+	excludeShorts   bool
+	excludeUnlisted bool
+	premiereMaxAge  time.Duration
+	postLiveDelay   time.Duration
+
+	cursor string
+
+	audioExt  string
+	audioMime string
 }
 
 var defaultOptions options = options{
@@ -34,6 +65,12 @@ var defaultOptions options = options{
 	enclosureBase: "",
 }
 
+// excludesEnabled reports whether any exclude predicate is active, so videos
+// can skip the extra batched Videos.List call when nothing needs it.
+func (o options) excludesEnabled() bool {
+	return o.excludeLive || o.excludeShorts || o.excludeUnlisted || o.premiereMaxAge > 0 || o.postLiveDelay > 0
+}
+
 type Option func(o options) options
 
 func WithLimit(limit int) func(o options) options {
@@ -64,6 +101,72 @@ func WithEnclosureBase(base string) func(o options) options {
 	}
 }
 
+// WithExcludeLive drops videos that are currently live when exclude is true.
+func WithExcludeLive(exclude bool) func(o options) options {
+	return func(o options) options {
+		o.excludeLive = exclude
+		return o
+	}
+}
+
+// WithExcludeShorts drops videos under a minute long when exclude is true.
+func WithExcludeShorts(exclude bool) func(o options) options {
+	return func(o options) options {
+		o.excludeShorts = exclude
+		return o
+	}
+}
+
+// WithExcludeUnlisted drops unlisted videos when exclude is true.
+func WithExcludeUnlisted(exclude bool) func(o options) options {
+	return func(o options) options {
+		o.excludeUnlisted = exclude
+		return o
+	}
+}
+
+// WithExcludePremiereMaxAge drops premieres scheduled more than maxAge ago
+// that never actually went live, e.g. to hide stale premiere announcements.
+// maxAge is kept as a duration rather than resolved to an absolute cutoff
+// here, so it stays a stable cache key even though "now" keeps moving.
+func WithExcludePremiereMaxAge(maxAge time.Duration) func(o options) options {
+	return func(o options) options {
+		o.premiereMaxAge = maxAge
+		return o
+	}
+}
+
+// WithPostLiveDelay holds back a livestream for delay after it ends, so
+// the VOD url has time to settle before it's published.
+func WithPostLiveDelay(delay time.Duration) func(o options) options {
+	return func(o options) options {
+		o.postLiveDelay = delay
+		return o
+	}
+}
+
+// WithAudioOutput overrides the enclosure's extension and mime type to
+// reflect serve-local's -audio transcoding, independently of format (which
+// still only selects the yt-dlp/on-demand download format). Call with
+// ext == "" to leave the enclosure type derived from format/mimetype as
+// usual.
+func WithAudioOutput(ext, mimeType string) func(o options) options {
+	return func(o options) options {
+		o.audioExt = ext
+		o.audioMime = mimeType
+		return o
+	}
+}
+
+// WithCursor resumes a Merge call right after the item the previous call's
+// cursor points at, so callers can page through a merged feed.
+func WithCursor(cursor string) func(o options) options {
+	return func(o options) options {
+		o.cursor = cursor
+		return o
+	}
+}
+
 type YoutubeAPIService struct {
 	ApiKey   string
 	Cache    *Cache
@@ -112,39 +215,457 @@ func (y *YoutubeAPIService) Channel(ctx context.Context, id string, o ...Option)
 	}, nil
 }
 
-func (y *YoutubeAPIService) videos(ctx context.Context, playlistId string, o options) ([]*feeds.Item, error) {
-	y.Cache.InvalidateCacheIfDirty(playlistId, o.limit)
+// PodcastChannel builds on Channel, additionally fetching the video details
+// (duration, category, thumbnail) needed to render the itunes/podcast
+// namespace extensions that a plain feeds.Feed has no room for.
+func (y *YoutubeAPIService) PodcastChannel(ctx context.Context, id string, o ...Option) (*PodcastFeed, error) {
+	options := defaultOptions
+	for _, opt := range o {
+		options = opt(options)
+	}
+	feed, err := y.Channel(ctx, id, o...)
+	if err != nil {
+		return nil, err
+	}
 	client, err := y.client(ctx)
 	if err != nil {
 		return nil, err
 	}
-	call := client.PlaylistItems.List([]string{"contentDetails", "snippet"}).PlaylistId(playlistId)
+	ids := make([]string, len(feed.Items))
+	for i, item := range feed.Items {
+		ids[i] = item.Id
+	}
+	details, err := y.videoDetails(ctx, client, ids, "contentDetails,snippet")
+	if err != nil {
+		return nil, fmt.Errorf("could not load video details for podcast feed: %w", err)
+	}
+
+	var category string
+	podcastItems := make([]*PodcastItem, 0, len(feed.Items))
+	for _, item := range feed.Items {
+		podcastItem := &PodcastItem{Item: item, Guid: item.Id}
+		if len(options.enclosureBase) > 0 && len(chaptersFromDescription(item.Description)) > 0 {
+			podcastItem.ChaptersUrl = fmt.Sprintf("%s/chapters/%s.json", options.enclosureBase, item.Id)
+		}
+		if video, ok := details[item.Id]; ok {
+			if duration, err := parseISO8601Duration(video.ContentDetails.Duration); err == nil {
+				podcastItem.Duration = duration
+			}
+			if video.Snippet != nil && video.Snippet.Thumbnails != nil && video.Snippet.Thumbnails.Default != nil {
+				podcastItem.Image = video.Snippet.Thumbnails.Default.Url
+			}
+			if category == "" && video.Snippet != nil {
+				category = video.Snippet.CategoryId
+			}
+		}
+		podcastItems = append(podcastItems, podcastItem)
+	}
+
+	return &PodcastFeed{
+		Feed:       feed,
+		Author:     feed.Title,
+		Owner:      &PodcastPerson{Name: feed.Title},
+		Categories: []string{itunesCategory(category)},
+		Items:      podcastItems,
+	}, nil
+}
+
+// Playlist builds a feed directly from a playlist id, bypassing the
+// channel -> uploads-playlist lookup Channel does. It shares the same
+// paginated, cache-backed fetch as Channel via videos.
+func (y *YoutubeAPIService) Playlist(ctx context.Context, playlistId string, o ...Option) (*feeds.Feed, error) {
+	options := defaultOptions
+	for _, opt := range o {
+		options = opt(options)
+	}
+	client, err := y.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	playlistResponse, err := client.Playlists.List([]string{"snippet"}).Id(playlistId).Do()
+	if err != nil {
+		return nil, fmt.Errorf("could not read playlist details: %w", err)
+	}
+	if len(playlistResponse.Items) != 1 {
+		return nil, fmt.Errorf("could not find playlist with id %s", playlistId)
+	}
+	playlist := playlistResponse.Items[0]
+
+	videos, err := y.videos(ctx, playlistId, options)
+	if err != nil {
+		return nil, fmt.Errorf("could not load videos from playlist %s: %w", playlistId, err)
+	}
+
+	thumbnail := playlist.Snippet.Thumbnails.Default
+	return &feeds.Feed{
+		Title:       playlist.Snippet.Title,
+		Image:       &feeds.Image{Url: thumbnail.Url, Width: int(thumbnail.Width), Height: int(thumbnail.Height)},
+		Id:          playlist.Id,
+		Link:        &feeds.Link{Href: fmt.Sprintf("https://youtube.com/playlist?list=%s", playlist.Id)},
+		Items:       videos,
+		Description: playlist.Snippet.Description,
+	}, nil
+}
+
+// Search builds a feed from a YouTube video search, newest first. Results
+// are cached and paginated the same way as Channel and Playlist, keyed by
+// the query itself rather than a playlist id, and honor the same
+// WithExclude*/WithPostLiveDelay filters Channel and Playlist do.
+func (y *YoutubeAPIService) Search(ctx context.Context, query string, o ...Option) (*feeds.Feed, error) {
+	options := defaultOptions
+	for _, opt := range o {
+		options = opt(options)
+	}
+	cacheKey := cacheKeyWithFilters("search:"+query, options)
+	y.Cache.InvalidateCacheIfDirty(cacheKey, options.limit)
+	client, err := y.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	call := client.Search.List([]string{"snippet"}).Q(query).Type("video").Order("date")
+
 	videos := make([]*feeds.Item, 0)
-	for item, err := range take(o.limit, y.allPlaylistItems(ctx, call)) {
-		if err != nil {
+	stop := false
+	const batchSize = 50
+	batch := make([]*youtube.SearchResult, 0, batchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		defer func() { batch = batch[:0] }()
+
+		details := map[string]*youtube.Video{}
+		if options.excludesEnabled() {
+			ids := make([]string, len(batch))
+			for i, result := range batch {
+				ids[i] = result.Id.VideoId
+			}
+			details, err = y.videoDetails(ctx, client, ids, "contentDetails,status,liveStreamingDetails")
+			if err != nil {
+				return fmt.Errorf("could not load video details for filtering: %w", err)
+			}
+		}
+
+		for _, result := range batch {
+			if options.excludesEnabled() && !passesExcludeFilters(details[result.Id.VideoId], options) {
+				continue
+			}
+			video, err := y.mapSearchResultToFeedItem(result, options)
+			if err != nil {
+				return err
+			}
+			videos = append(videos, video)
+			if y.Cache.HasItem(cacheKey, video) {
+				stop = true
+				break
+			}
+		}
+		return nil
+	}
+
+	for result, itemErr := range take(options.limit, y.allSearchResults(ctx, call)) {
+		if itemErr != nil {
+			return nil, itemErr
+		}
+		batch = append(batch, result)
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			if stop {
+				break
+			}
+		}
+	}
+	if !stop {
+		if err := flush(); err != nil {
 			return nil, err
 		}
-		video, err := y.mapToFeedItem(item, o)
+	}
+
+	y.Cache.Put(cacheKey, videos...)
+	videos, err = topUpFromCache(y.Cache, cacheKey, videos, options.limit)
+	if err != nil {
+		return nil, err
+	}
+	y.Cache.UpdateMaxLimit(cacheKey, options.limit)
+
+	return &feeds.Feed{
+		Title: fmt.Sprintf("Search: %s", query),
+		Id:    cacheKey,
+		Link:  &feeds.Link{Href: fmt.Sprintf("https://youtube.com/results?search_query=%s", url.QueryEscape(query))},
+		Items: videos,
+	}, nil
+}
+
+// Merge fetches each of the given channels and returns their items unioned
+// and deduped by video id, newest first. Unlike Channel and Playlist it
+// keeps no cache bucket of its own: every source channel already caches its
+// own items, and merge order only depends on the Created timestamps they
+// carry. The returned cursor resumes right after the last item of this
+// page; pass it back via WithCursor to get the next one.
+func (y *YoutubeAPIService) Merge(ctx context.Context, ids []string, o ...Option) (*feeds.Feed, string, error) {
+	options := defaultOptions
+	for _, opt := range o {
+		options = opt(options)
+	}
+
+	// Each source channel is fetched at full depth rather than capped to
+	// options.limit: capping it would mean a cursor past that window can
+	// never be found in a freshly re-fetched page, landing back on page 1
+	// forever instead of paging forward. Trimming to options.limit happens
+	// once, after the merge, in mergeFeedItems.
+	perSourceOpts := append(append([]Option{}, o...), WithLimit(defaultOptions.limit))
+
+	var merged []*feeds.Item
+	titles := make([]string, 0, len(ids))
+	for _, id := range ids {
+		channel, err := y.Channel(ctx, id, perSourceOpts...)
+		if err != nil {
+			return nil, "", fmt.Errorf("could not load channel %s for merge: %w", id, err)
+		}
+		merged = append(merged, channel.Items...)
+		titles = append(titles, channel.Title)
+	}
+
+	page, nextCursor := mergeFeedItems(merged, options.cursor, options.limit)
+	return &feeds.Feed{
+		Title: fmt.Sprintf("Merge: %s", strings.Join(titles, ", ")),
+		Id:    "merge:" + strings.Join(ids, ","),
+		Link:  &feeds.Link{Href: options.enclosureBase},
+		Items: page,
+	}, nextCursor, nil
+}
+
+// mergeFeedItems sorts items newest first, drops duplicate video ids, skips
+// past everything up to and including cursor, and caps the result at limit.
+// It returns the cursor the caller should pass back in to continue after the
+// last returned item, or "" once nothing is left.
+func mergeFeedItems(items []*feeds.Item, cursor string, limit int) ([]*feeds.Item, string) {
+	sort.Slice(items, func(i, j int) bool { return items[i].Created.After(items[j].Created) })
+
+	seen := make(map[string]bool, len(items))
+	deduped := make([]*feeds.Item, 0, len(items))
+	for _, item := range items {
+		if seen[item.Id] {
+			continue
+		}
+		seen[item.Id] = true
+		deduped = append(deduped, item)
+	}
+
+	if cursor != "" {
+		for i, item := range deduped {
+			if itemCursor(item) == cursor {
+				deduped = deduped[i+1:]
+				break
+			}
+		}
+	}
+
+	if limit > 0 && limit < len(deduped) {
+		return deduped[:limit], itemCursor(deduped[limit-1])
+	}
+	return deduped, ""
+}
+
+// itemCursor encodes a stable position in a merged, date-ordered feed. It is
+// derived from the same (Created, Id) pair the bbolt cache keys on, so it
+// stays valid even as new items get merged in ahead of it.
+func itemCursor(item *feeds.Item) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s|%s", item.Created.Format(time.RFC3339), item.Id)))
+}
+
+func (y *YoutubeAPIService) mapSearchResultToFeedItem(item *youtube.SearchResult, o options) (*feeds.Item, error) {
+	published, err := time.Parse(time.RFC3339, item.Snippet.PublishedAt)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse published date of video %s: %w", item.Id.VideoId, err)
+	}
+	enclosure, err := buildEnclosure(item.Id.VideoId, o)
+	if err != nil {
+		return nil, fmt.Errorf("could not format enclosure url: %w", err)
+	}
+	return &feeds.Item{
+		Title:       item.Snippet.Title,
+		Link:        &feeds.Link{Href: fmt.Sprintf("https://youtube.com/watch?v=%s", item.Id.VideoId)},
+		Id:          item.Id.VideoId,
+		Created:     published,
+		Description: item.Snippet.Description,
+		Enclosure:   enclosure,
+	}, nil
+}
+
+func (y *YoutubeAPIService) allSearchResults(ctx context.Context, call *youtube.SearchListCall) iter.Seq2[*youtube.SearchResult, error] {
+	return func(yield func(*youtube.SearchResult, error) bool) {
+		cancel := errors.New("cancelled")
+		err := call.Pages(ctx, func(sl *youtube.SearchListResponse) error {
+			for _, e := range sl.Items {
+				if !yield(e, nil) {
+					return cancel
+				}
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, cancel) {
+			yield(nil, err)
+		}
+	}
+}
+
+// videoDetails batch-fetches the given parts (e.g. "contentDetails,snippet")
+// for videoIds via Videos.List, since PlaylistItems.List only returns a
+// snippet and contentDetails.videoId, never duration, status or live info.
+func (y *YoutubeAPIService) videoDetails(ctx context.Context, client *youtube.Service, videoIds []string, parts string) (map[string]*youtube.Video, error) {
+	result := make(map[string]*youtube.Video, len(videoIds))
+	const batchSize = 50
+	for i := 0; i < len(videoIds); i += batchSize {
+		end := min(i+batchSize, len(videoIds))
+		response, err := client.Videos.List(strings.Split(parts, ",")).Id(videoIds[i:end]...).Context(ctx).Do()
 		if err != nil {
 			return nil, err
 		}
-		videos = append(videos, video)
-		if y.Cache.HasItem(playlistId, video) {
-			break
+		for _, video := range response.Items {
+			result[video.Id] = video
 		}
 	}
-	y.Cache.Put(playlistId, videos...)
-	after := videos[len(videos)-1].Created.Format(time.RFC3339)
-	for item, err := range take(max(0, o.limit-len(videos)), y.Cache.Iter(playlistId, after)) {
-		if err != nil {
+	return result, nil
+}
+
+func (y *YoutubeAPIService) videos(ctx context.Context, playlistId string, o options) ([]*feeds.Item, error) {
+	cacheKey := cacheKeyWithFilters(playlistId, o)
+	y.Cache.InvalidateCacheIfDirty(cacheKey, o.limit)
+	client, err := y.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	call := client.PlaylistItems.List([]string{"contentDetails", "snippet"}).PlaylistId(playlistId)
+
+	videos := make([]*feeds.Item, 0)
+	stop := false
+	const batchSize = 50
+	batch := make([]*youtube.PlaylistItem, 0, batchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		defer func() { batch = batch[:0] }()
+
+		details := map[string]*youtube.Video{}
+		if o.excludesEnabled() {
+			ids := make([]string, len(batch))
+			for i, item := range batch {
+				ids[i] = item.Snippet.ResourceId.VideoId
+			}
+			details, err = y.videoDetails(ctx, client, ids, "contentDetails,status,liveStreamingDetails")
+			if err != nil {
+				return fmt.Errorf("could not load video details for filtering: %w", err)
+			}
+		}
+
+		for _, item := range batch {
+			if o.excludesEnabled() && !passesExcludeFilters(details[item.Snippet.ResourceId.VideoId], o) {
+				continue
+			}
+			video, err := y.mapToFeedItem(item, o)
+			if err != nil {
+				return err
+			}
+			videos = append(videos, video)
+			if y.Cache.HasItem(cacheKey, video) {
+				stop = true
+				break
+			}
+		}
+		return nil
+	}
+
+	for item, itemErr := range take(o.limit, y.allPlaylistItems(ctx, call)) {
+		if itemErr != nil {
+			return nil, itemErr
+		}
+		batch = append(batch, item)
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			if stop {
+				break
+			}
+		}
+	}
+	if !stop {
+		if err := flush(); err != nil {
 			return nil, err
 		}
-		videos = append(videos, item)
 	}
-	y.Cache.UpdateMaxLimit(playlistId, o.limit)
+
+	y.Cache.Put(cacheKey, videos...)
+	videos, err = topUpFromCache(y.Cache, cacheKey, videos, o.limit)
+	if err != nil {
+		return nil, err
+	}
+	y.Cache.UpdateMaxLimit(cacheKey, o.limit)
 	return videos, nil
 }
 
+// cacheKeyWithFilters folds the active exclude predicates into a base cache
+// key, so a request with one filter combination (e.g. excludeShorts=true)
+// never serves from, or writes into, the bucket backing a different
+// combination over the same base key. Without filters active it's just
+// baseKey, same as before these filters existed. Every predicate folded in
+// here must be stable across requests with the same intent (e.g. the
+// premiere cutoff is a duration, not the ever-advancing absolute instant
+// derived from it) or every request would mint its own never-reused bucket.
+func cacheKeyWithFilters(baseKey string, o options) string {
+	if !o.excludesEnabled() {
+		return baseKey
+	}
+	return fmt.Sprintf("%s|xl=%t,xs=%t,xu=%t,xp=%s,ld=%s",
+		baseKey, o.excludeLive, o.excludeShorts, o.excludeUnlisted,
+		o.premiereMaxAge, o.postLiveDelay)
+}
+
+// passesExcludeFilters applies the WithExclude*/WithPostLiveDelay predicates
+// to a video. details is nil when the Videos.List lookup didn't return this
+// id (e.g. the video was deleted in the meantime); such videos are let
+// through rather than silently hidden.
+func passesExcludeFilters(details *youtube.Video, o options) bool {
+	if details == nil {
+		return true
+	}
+	if o.excludeUnlisted && details.Status != nil && details.Status.PrivacyStatus == "unlisted" {
+		return false
+	}
+
+	live := details.LiveStreamingDetails
+	if live != nil {
+		if o.excludeLive && live.ActualStartTime != "" && live.ActualEndTime == "" {
+			return false // currently live
+		}
+		if o.premiereMaxAge > 0 && live.ActualStartTime == "" && live.ScheduledStartTime != "" {
+			if scheduled, err := time.Parse(time.RFC3339, live.ScheduledStartTime); err == nil && time.Since(scheduled) > o.premiereMaxAge {
+				return false // premiere that never went live, and is old enough to consider stale
+			}
+		}
+		if o.postLiveDelay > 0 && live.ActualEndTime != "" {
+			if ended, err := time.Parse(time.RFC3339, live.ActualEndTime); err == nil && time.Since(ended) < o.postLiveDelay {
+				return false // just-ended livestream, give the VOD url time to settle
+			}
+		}
+	}
+
+	if o.excludeShorts && details.ContentDetails != nil {
+		if seconds, err := parseISO8601Seconds(details.ContentDetails.Duration); err == nil && seconds < 60 {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (y *YoutubeAPIService) mapToFeedItem(item *youtube.PlaylistItem, o options) (*feeds.Item, error) {
 	published, err := time.Parse(time.RFC3339, item.Snippet.PublishedAt)
 	if err != nil {
@@ -182,22 +703,47 @@ func (y *YoutubeAPIService) allPlaylistItems(ctx context.Context, call *youtube.
 }
 
 func (y *YoutubeAPIService) formatEnclosure(v *youtube.PlaylistItem, o options) (*feeds.Enclosure, error) {
+	return buildEnclosure(v.Snippet.ResourceId.VideoId, o)
+}
+
+// buildEnclosure builds the enclosure url pointing back at this server's
+// /watch endpoint. It is shared by every YtSerice backend, since none of
+// them control how /watch itself resolves or serves the video.
+func buildEnclosure(videoId string, o options) (*feeds.Enclosure, error) {
 	if len(o.enclosureBase) == 0 {
 		return nil, nil
 	}
-	vId := v.Snippet.ResourceId.VideoId
-	extension, err := mime.ExtensionsByType(o.mimetype)
-	if err != nil {
-		return nil, err
+
+	mimeType := o.mimetype
+	ext := ""
+	switch {
+	case o.format == "audio":
+		mimeType = "audio/mpeg"
+		ext = ".mp3"
+	case o.audioExt != "":
+		// serve-local's -audio flag transcodes every download regardless of
+		// format/mimetype, so the enclosure must reflect that rather than the
+		// raw download format the Downloader fetches with.
+		mimeType = o.audioMime
+		ext = "." + o.audioExt
+	default:
+		extensions, err := mime.ExtensionsByType(mimeType)
+		if err != nil {
+			return nil, err
+		}
+		if len(extensions) > 0 {
+			ext = extensions[len(extensions)-1]
+		}
 	}
 
 	var enc *url.URL
+	var err error
 	query := make(url.Values)
-	if len(extension) == 0 {
+	if len(ext) == 0 {
 		enc, err = url.Parse(fmt.Sprintf("%s/watch", o.enclosureBase))
-		query.Add("v", vId)
+		query.Add("v", videoId)
 	} else {
-		enc, err = url.Parse(fmt.Sprintf("%s/watch/%s%s", o.enclosureBase, vId, extension[len(extension)-1]))
+		enc, err = url.Parse(fmt.Sprintf("%s/watch/%s%s", o.enclosureBase, videoId, ext))
 	}
 	if err != nil {
 		return nil, fmt.Errorf("could not parse enclosure base url: %w", err)
@@ -208,7 +754,7 @@ func (y *YoutubeAPIService) formatEnclosure(v *youtube.PlaylistItem, o options)
 
 	enc.RawQuery = query.Encode()
 
-	return &feeds.Enclosure{Url: enc.String(), Length: "-1", Type: o.mimetype}, nil
+	return &feeds.Enclosure{Url: enc.String(), Length: "-1", Type: mimeType}, nil
 }
 
 func (y *YoutubeAPIService) client(ctx context.Context) (*youtube.Service, error) {